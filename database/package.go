@@ -0,0 +1,42 @@
+// Copyright 2015 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package database
+
+import "github.com/coreos/clair/utils/types"
+
+// Package is a package detected in a container layer's filesystem. Name and
+// Version always describe the binary package itself; SourceName and
+// SourceVersion describe the source package it was built from, and are set
+// to the binary package's own Name and Version when the package metadata
+// names no separate source package. Some vulnerability feeds (e.g.
+// Debian's) publish advisories against the source package rather than the
+// binary one, so both identities need to be kept around for matching.
+type Package struct {
+	Name    string
+	Version types.Version
+
+	// Architecture distinguishes multi-arch packages of the same Name and
+	// Version (e.g. libc6:amd64 vs libc6:i386) that are installed side by
+	// side. It is empty when the package format has no notion of it.
+	Architecture string
+
+	SourceName    string
+	SourceVersion types.Version
+}
+
+// Key returns a string that uniquely identifies the package within a layer
+func (p *Package) Key() string {
+	return p.Name + ":" + p.Version.String() + ":" + p.Architecture
+}
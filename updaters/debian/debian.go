@@ -0,0 +1,35 @@
+// Copyright 2015 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package debian matches detected packages against Debian vulnerability data
+package debian
+
+import (
+	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/utils/types"
+)
+
+// Affects reports whether pkg is vulnerable to an advisory fixed by
+// fixedInVersion of fixedInName. Debian Security Advisories are published
+// against either the binary package name or the source package it was built
+// from, so pkg's binary and source identities are both checked.
+func Affects(pkg *database.Package, fixedInName string, fixedInVersion types.Version) bool {
+	if pkg.Name == fixedInName {
+		return pkg.Version.Compare(fixedInVersion) < 0
+	}
+	if pkg.SourceName == fixedInName {
+		return pkg.SourceVersion.Compare(fixedInVersion) < 0
+	}
+	return false
+}
@@ -0,0 +1,107 @@
+// Copyright 2015 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package packages
+
+import (
+	"bufio"
+	"strings"
+
+	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/utils/types"
+	"github.com/coreos/clair/worker/detectors"
+)
+
+// ApkPackagesDetector implements PackagesDetector and detects apk packages
+type ApkPackagesDetector struct{}
+
+func init() {
+	detectors.RegisterPackagesDetector("apk", &ApkPackagesDetector{})
+}
+
+// Detect detects packages using lib/apk/db/installed from the input data
+func (detector *ApkPackagesDetector) Detect(data map[string][]byte) ([]*database.Package, error) {
+	f, hasFile := data["lib/apk/db/installed"]
+	if !hasFile {
+		return []*database.Package{}, nil
+	}
+
+	// Create a map to store packages and ensure their uniqueness
+	packagesMap := make(map[string]*database.Package)
+
+	var pkg *database.Package
+	var err error
+	scanner := bufio.NewScanner(strings.NewReader(string(f)))
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if strings.HasPrefix(line, "P:") {
+			// Package line
+			// Defines the name of the package
+
+			pkg = &database.Package{
+				Name: strings.TrimSpace(strings.TrimPrefix(line, "P:")),
+			}
+		} else if pkg != nil && strings.HasPrefix(line, "V:") {
+			// Version line
+			// Defines the version of the package
+
+			pkg.Version, err = types.NewVersion(strings.TrimPrefix(line, "V:"))
+			if err != nil {
+				log.Warningf("could not parse package version '%s': %s. skipping", line, err.Error())
+			}
+		} else if pkg != nil && strings.HasPrefix(line, "o:") {
+			// Origin line (Optional)
+			// Gives the name of the source package, like the dpkg Source
+			// field does; kept separate from Name so that subpackages
+			// sharing one origin aren't collapsed into a single entry
+
+			pkg.SourceName = strings.TrimSpace(strings.TrimPrefix(line, "o:"))
+		} else if strings.TrimSpace(line) == "" {
+			// Blank line: end of the current stanza
+
+			if pkg != nil && pkg.Name != "" && pkg.Version.String() != "" {
+				if pkg.SourceName == "" {
+					pkg.SourceName = pkg.Name
+				}
+				pkg.SourceVersion = pkg.Version
+				packagesMap[pkg.Key()] = pkg
+			}
+			pkg = nil
+		}
+	}
+
+	// The file may not end with a blank line: flush the last stanza too
+	if pkg != nil && pkg.Name != "" && pkg.Version.String() != "" {
+		if pkg.SourceName == "" {
+			pkg.SourceName = pkg.Name
+		}
+		pkg.SourceVersion = pkg.Version
+		packagesMap[pkg.Key()] = pkg
+	}
+
+	// Convert the map to a slice
+	packages := make([]*database.Package, 0, len(packagesMap))
+	for _, pkg := range packagesMap {
+		packages = append(packages, pkg)
+	}
+
+	return packages, nil
+}
+
+// GetRequiredFiles returns the list of files required for Detect, without
+// leading /
+func (detector *ApkPackagesDetector) GetRequiredFiles() []string {
+	return []string{"lib/apk/db/installed"}
+}
@@ -17,6 +17,7 @@ package packages
 
 import (
 	"bufio"
+	"bytes"
 	"regexp"
 	"strings"
 
@@ -29,8 +30,26 @@ import (
 var (
 	log = capnslog.NewPackageLogger("github.com/coreos/clair", "worker/detectors/packages")
 
-	dpkgSrcCaptureRegexp      = regexp.MustCompile(`Source: (?P<name>[^\s]*)( \((?P<version>.*)\))?`)
-	dpkgSrcCaptureRegexpNames = dpkgSrcCaptureRegexp.SubexpNames()
+	// dpkgSrcCaptureRegexpBytes is matched directly against the scanner's
+	// raw []byte line via FindSubmatch, so no string copy of the line is
+	// needed just to capture the Source: field
+	dpkgSrcCaptureRegexpBytes = regexp.MustCompile(`Source: (?P<name>[^\s]*)( \((?P<version>.*)\))?`)
+	dpkgSrcCaptureRegexpNames = dpkgSrcCaptureRegexpBytes.SubexpNames()
+
+	dpkgPackagePrefix      = []byte("Package: ")
+	dpkgStatusPrefix       = []byte("Status: ")
+	dpkgArchitecturePrefix = []byte("Architecture: ")
+	dpkgSourcePrefix       = []byte("Source: ")
+	dpkgVersionPrefix      = []byte("Version: ")
+
+	// dpkgInstalledState is the status-field word that means the package is
+	// actually present on disk. Status is a "want flag status" triple (e.g.
+	// "install ok installed", "hold ok installed", "deinstall ok
+	// config-files") and only the third word matters here: want can be
+	// "hold" for a package pinned with apt-mark hold, which is still
+	// installed, while status can be e.g. "config-files" for a package that
+	// has been removed but left its configuration behind
+	dpkgInstalledState = "installed"
 )
 
 // DpkgPackagesDetector implements PackagesDetector and detects dpkg packages
@@ -51,50 +70,83 @@ func (detector *DpkgPackagesDetector) Detect(data map[string][]byte) ([]*databas
 	packagesMap := make(map[string]*database.Package)
 
 	var pkg *database.Package
+	var status string
 	var err error
-	scanner := bufio.NewScanner(strings.NewReader(string(f)))
+	scanner := bufio.NewScanner(bytes.NewReader(f))
 	for scanner.Scan() {
-		line := scanner.Text()
+		line := scanner.Bytes()
 
-		if strings.HasPrefix(line, "Package: ") {
+		if bytes.HasPrefix(line, dpkgPackagePrefix) {
 			// Package line
 			// Defines the name of the package
 
 			pkg = &database.Package{
-				Name: strings.TrimSpace(strings.TrimPrefix(line, "Package: ")),
+				Name: string(bytes.TrimSpace(bytes.TrimPrefix(line, dpkgPackagePrefix))),
 			}
-		} else if pkg != nil && strings.HasPrefix(line, "Source: ") {
+			status = ""
+		} else if pkg != nil && bytes.HasPrefix(line, dpkgStatusPrefix) {
+			// Status line
+			// Tells whether the package is actually installed, or merely
+			// known to dpkg (e.g. removed but with config files left behind)
+
+			status = string(bytes.TrimSpace(bytes.TrimPrefix(line, dpkgStatusPrefix)))
+		} else if pkg != nil && bytes.HasPrefix(line, dpkgArchitecturePrefix) {
+			// Architecture line
+			// On multi-arch systems, the same package name can be installed
+			// once per architecture (e.g. libc6:amd64 and libc6:i386), so it
+			// is stored on the package and folded into Key() below
+
+			pkg.Architecture = string(bytes.TrimSpace(bytes.TrimPrefix(line, dpkgArchitecturePrefix)))
+		} else if pkg != nil && bytes.HasPrefix(line, dpkgSourcePrefix) {
 			// Source line (Optionnal)
-			// Gives the name of the source package
-			// May also specifies a version
+			// Gives the name of the source package the binary was built
+			// from, and may also specify a version if it differs from the
+			// binary package's own version
 
-			srcCapture := dpkgSrcCaptureRegexp.FindAllStringSubmatch(line, -1)[0]
+			srcCapture := dpkgSrcCaptureRegexpBytes.FindSubmatch(line)
 			md := map[string]string{}
 			for i, n := range srcCapture {
-				md[dpkgSrcCaptureRegexpNames[i]] = strings.TrimSpace(n)
+				md[dpkgSrcCaptureRegexpNames[i]] = strings.TrimSpace(string(n))
 			}
 
-			pkg.Name = md["name"]
+			pkg.SourceName = md["name"]
 			if md["version"] != "" {
-				pkg.Version, err = types.NewVersion(md["version"])
+				pkg.SourceVersion, err = types.NewVersion(md["version"])
 				if err != nil {
-					log.Warningf("could not parse package version '%s': %s. skipping", line[1], err.Error())
+					log.Warningf("could not parse source package version '%s': %s. skipping", line, err.Error())
 				}
 			}
-		} else if pkg != nil && strings.HasPrefix(line, "Version: ") && pkg.Version.String() == "" {
+		} else if pkg != nil && bytes.HasPrefix(line, dpkgVersionPrefix) && pkg.Version.String() == "" {
 			// Version line
 			// Defines the version of the package
 			// This version is less important than a version retrieved from a Source line
 			// because the Debian vulnerabilities often skips the epoch from the Version field
 			// which is not present in the Source version, and because +bX revisions don't matter
-			pkg.Version, err = types.NewVersion(strings.TrimPrefix(line, "Version: "))
+			pkg.Version, err = types.NewVersion(string(bytes.TrimPrefix(line, dpkgVersionPrefix)))
 			if err != nil {
-				log.Warningf("could not parse package version '%s': %s. skipping", line[1], err.Error())
+				log.Warningf("could not parse package version '%s': %s. skipping", line, err.Error())
 			}
 		}
 
 		// Add the package to the result array if we have all the informations
 		if pkg != nil && pkg.Name != "" && pkg.Version.String() != "" {
+			if statusFields := strings.Fields(status); len(statusFields) == 3 && statusFields[2] != dpkgInstalledState {
+				// Package is known to dpkg but not actually installed
+				// (removed, half-installed, etc.): ignore it
+				pkg = nil
+				continue
+			}
+
+			// Debian policy defaults the source package to the binary
+			// package of the same name and version when no Source field
+			// is present
+			if pkg.SourceName == "" {
+				pkg.SourceName = pkg.Name
+			}
+			if pkg.SourceVersion.String() == "" {
+				pkg.SourceVersion = pkg.Version
+			}
+
 			packagesMap[pkg.Key()] = pkg
 			pkg = nil
 		}
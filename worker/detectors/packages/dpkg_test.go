@@ -0,0 +1,136 @@
+// Copyright 2015 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package packages
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+// dpkgStatusStanza is a realistic dpkg status stanza, repeated to build a
+// status file comparable in size to the ones found on real Debian/Ubuntu
+// images (several thousand installed packages).
+const dpkgStatusStanza = `Package: libexample%[1]d
+Status: install ok installed
+Priority: optional
+Section: libs
+Installed-Size: 123
+Maintainer: Example Maintainer <maintainer@example.com>
+Architecture: amd64
+Source: example%[1]d (1.2.3-4)
+Version: 1.2.3-4ubuntu1
+Depends: libc6 (>= 2.17)
+Description: example library number %[1]d
+
+`
+
+func buildDpkgStatusFile(packageCount int) []byte {
+	var buf bytes.Buffer
+	for i := 0; i < packageCount; i++ {
+		fmt.Fprintf(&buf, dpkgStatusStanza, i)
+	}
+	return buf.Bytes()
+}
+
+func TestDpkgPackagesDetector_Detect_Status(t *testing.T) {
+	data := map[string][]byte{
+		"var/lib/dpkg/status": []byte(`Package: held-package
+Status: hold ok installed
+Architecture: amd64
+Version: 1.0-1
+
+Package: removed-package
+Status: deinstall ok config-files
+Architecture: amd64
+Version: 1.0-1
+
+Package: installed-package
+Status: install ok installed
+Architecture: amd64
+Version: 1.0-1
+
+`),
+	}
+
+	packages, err := (&DpkgPackagesDetector{}).Detect(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := map[string]bool{}
+	for _, pkg := range packages {
+		names[pkg.Name] = true
+	}
+
+	if !names["held-package"] {
+		t.Error("expected held-package (apt-mark hold) to be reported as installed")
+	}
+	if !names["installed-package"] {
+		t.Error("expected installed-package to be reported as installed")
+	}
+	if names["removed-package"] {
+		t.Error("expected removed-package (deinstall, config-files left behind) to be skipped")
+	}
+}
+
+func TestDpkgPackagesDetector_Detect_MultiArch(t *testing.T) {
+	data := map[string][]byte{
+		"var/lib/dpkg/status": []byte(`Package: libc6
+Status: install ok installed
+Architecture: amd64
+Version: 2.31-0ubuntu1
+
+Package: libc6
+Status: install ok installed
+Architecture: i386
+Version: 2.31-0ubuntu1
+
+`),
+	}
+
+	packages, err := (&DpkgPackagesDetector{}).Detect(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(packages) != 2 {
+		t.Fatalf("got %d packages, want 2 (libc6:amd64 and libc6:i386 should not collapse)", len(packages))
+	}
+
+	if packages[0].Key() == packages[1].Key() {
+		t.Errorf("libc6:amd64 and libc6:i386 produced the same Key() %q", packages[0].Key())
+	}
+}
+
+func BenchmarkDpkgPackagesDetector_Detect(b *testing.B) {
+	const packageCount = 5000
+	data := map[string][]byte{
+		"var/lib/dpkg/status": buildDpkgStatusFile(packageCount),
+	}
+	detector := &DpkgPackagesDetector{}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		packages, err := detector.Detect(data)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if len(packages) != packageCount {
+			b.Fatalf("got %d packages, want %d", len(packages), packageCount)
+		}
+	}
+}
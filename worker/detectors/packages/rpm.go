@@ -0,0 +1,287 @@
+// Copyright 2015 clair authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package packages
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+
+	"github.com/coreos/clair/database"
+	"github.com/coreos/clair/utils"
+	"github.com/coreos/clair/utils/types"
+	"github.com/coreos/clair/worker/detectors"
+)
+
+const rpmDbPath = "var/lib/rpm/Packages"
+
+// rpm header tags we care about, as defined by rpm's rpmtag.h
+const (
+	rpmTagName      = 1000
+	rpmTagVersion   = 1001
+	rpmTagRelease   = 1002
+	rpmTagEpoch     = 1003
+	rpmTagSourceRpm = 1044
+
+	rpmStringType = 6
+	rpmInt32Type  = 4
+)
+
+var (
+	rpmHeaderMagic = []byte{0x8e, 0xad, 0xe8, 0x01}
+
+	// rpmSourceRpmRegexp extracts the source package name out of a
+	// SOURCERPM value such as "bash-4.2.46-34.el7.src.rpm"
+	rpmSourceRpmRegexp = regexp.MustCompile(`^(.+)-[^-]+-[^-]+\.[^.]+\.rpm$`)
+)
+
+// RpmPackagesDetector implements PackagesDetector and detects rpm packages
+type RpmPackagesDetector struct{}
+
+func init() {
+	detectors.RegisterPackagesDetector("rpm", &RpmPackagesDetector{})
+}
+
+// Detect detects packages using var/lib/rpm/Packages from the input data
+func (detector *RpmPackagesDetector) Detect(data map[string][]byte) ([]*database.Package, error) {
+	f, hasFile := data[rpmDbPath]
+	if !hasFile {
+		return []*database.Package{}, nil
+	}
+
+	pkgs, err := detectRpmPackagesNative(f)
+	if err != nil {
+		log.Warningf("could not parse %s natively: %s. falling back to the rpm binary", rpmDbPath, err.Error())
+		pkgs, err = detectRpmPackagesWithBinary(f)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Create a map to store packages and ensure their uniqueness
+	packagesMap := make(map[string]*database.Package)
+	for _, pkg := range pkgs {
+		packagesMap[pkg.Key()] = pkg
+	}
+
+	// Convert the map to a slice
+	packages := make([]*database.Package, 0, len(packagesMap))
+	for _, pkg := range packagesMap {
+		packages = append(packages, pkg)
+	}
+
+	return packages, nil
+}
+
+// detectRpmPackagesNative parses the rpm Berkeley DB file without shelling
+// out. Rather than walking the Berkeley DB page layout, which varies across
+// BDB versions, it relies on the fact that rpm stores each package as a
+// verbatim rpm header (magic + index + data store) and recovers every
+// header by locating its magic number directly in the raw bytes.
+func detectRpmPackagesNative(f []byte) ([]*database.Package, error) {
+	blobs := splitRpmHeaderBlobs(f)
+	if len(blobs) == 0 {
+		return nil, errors.New("no rpm headers found in " + rpmDbPath)
+	}
+
+	var packages []*database.Package
+	for _, blob := range blobs {
+		pkg, err := parseRpmHeaderBlob(blob)
+		if err != nil {
+			log.Warningf("could not parse rpm header: %s. skipping", err.Error())
+			continue
+		}
+		if pkg != nil {
+			packages = append(packages, pkg)
+		}
+	}
+
+	return packages, nil
+}
+
+// splitRpmHeaderBlobs scans raw bytes for rpm header magic numbers and
+// returns the byte range of each header found (magic + index + data store).
+func splitRpmHeaderBlobs(data []byte) [][]byte {
+	var blobs [][]byte
+
+	for i := 0; i+16 <= len(data); {
+		idx := bytes.Index(data[i:], rpmHeaderMagic)
+		if idx < 0 {
+			break
+		}
+		start := i + idx
+		if start+16 > len(data) {
+			break
+		}
+
+		il := int(binary.BigEndian.Uint32(data[start+8 : start+12]))
+		dl := int(binary.BigEndian.Uint32(data[start+12 : start+16]))
+		end := start + 16 + il*16 + dl
+		if il <= 0 || dl < 0 || end > len(data) {
+			// Not a real header, keep scanning right after the magic
+			i = start + len(rpmHeaderMagic)
+			continue
+		}
+
+		blobs = append(blobs, data[start:end])
+		i = end
+	}
+
+	return blobs
+}
+
+// parseRpmHeaderBlob decodes a single rpm header blob produced by
+// splitRpmHeaderBlobs into a database.Package
+func parseRpmHeaderBlob(blob []byte) (*database.Package, error) {
+	if len(blob) < 16 {
+		return nil, errors.New("rpm header too short")
+	}
+
+	il := int(binary.BigEndian.Uint32(blob[8:12]))
+	dl := int(binary.BigEndian.Uint32(blob[12:16]))
+	indexStart := 16
+	dataStart := indexStart + il*16
+	if dataStart+dl > len(blob) {
+		return nil, errors.New("rpm header truncated")
+	}
+	store := blob[dataStart : dataStart+dl]
+
+	strs := make(map[int32]string, il)
+	ints := make(map[int32]int32, il)
+	for i := 0; i < il; i++ {
+		entry := blob[indexStart+i*16 : indexStart+(i+1)*16]
+		tag := int32(binary.BigEndian.Uint32(entry[0:4]))
+		typ := int32(binary.BigEndian.Uint32(entry[4:8]))
+		offset := int(binary.BigEndian.Uint32(entry[8:12]))
+		if offset < 0 || offset > len(store) {
+			continue
+		}
+
+		switch typ {
+		case rpmStringType:
+			end := bytes.IndexByte(store[offset:], 0)
+			if end < 0 {
+				continue
+			}
+			strs[tag] = string(store[offset : offset+end])
+		case rpmInt32Type:
+			if offset+4 > len(store) {
+				continue
+			}
+			ints[tag] = int32(binary.BigEndian.Uint32(store[offset : offset+4]))
+		}
+	}
+
+	name := strs[rpmTagName]
+	version := strs[rpmTagVersion]
+	if name == "" || version == "" {
+		return nil, nil
+	}
+
+	verStr := version
+	if release := strs[rpmTagRelease]; release != "" {
+		verStr = verStr + "-" + release
+	}
+	if epoch, ok := ints[rpmTagEpoch]; ok {
+		verStr = strconv.Itoa(int(epoch)) + ":" + verStr
+	}
+
+	v, err := types.NewVersion(verStr)
+	if err != nil {
+		return nil, err
+	}
+
+	pkg := &database.Package{
+		Name:    name,
+		Version: v,
+	}
+
+	pkg.SourceName = pkg.Name
+	pkg.SourceVersion = pkg.Version
+	if sourceRpm := strs[rpmTagSourceRpm]; sourceRpm != "" {
+		if m := rpmSourceRpmRegexp.FindStringSubmatch(sourceRpm); m != nil {
+			pkg.SourceName = m[1]
+		}
+	}
+
+	return pkg, nil
+}
+
+// detectRpmPackagesWithBinary shells out to the rpm binary when it is
+// available on the host running the worker, for rpm databases whose on-disk
+// format the native reader fails to understand
+func detectRpmPackagesWithBinary(f []byte) ([]*database.Package, error) {
+	tmpDir, err := ioutil.TempDir("", "rpm")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	if err := ioutil.WriteFile(filepath.Join(tmpDir, "Packages"), f, 0700); err != nil {
+		return nil, err
+	}
+
+	out, err := utils.Exec(tmpDir, "rpm", "--dbpath", tmpDir, "-qa", "--qf", "%{NAME} %{EPOCH} %{VERSION} %{RELEASE} %{SOURCERPM}\n")
+	if err != nil {
+		return nil, err
+	}
+
+	var packages []*database.Package
+	for _, line := range bytes.Split(out, []byte("\n")) {
+		fields := bytes.Fields(line)
+		if len(fields) < 4 {
+			continue
+		}
+
+		name := string(fields[0])
+		epoch := string(fields[1])
+		verStr := string(fields[2]) + "-" + string(fields[3])
+		if epoch != "(none)" && epoch != "" {
+			verStr = epoch + ":" + verStr
+		}
+
+		v, err := types.NewVersion(verStr)
+		if err != nil {
+			log.Warningf("could not parse package version '%s': %s. skipping", verStr, err.Error())
+			continue
+		}
+
+		pkg := &database.Package{
+			Name:          name,
+			Version:       v,
+			SourceName:    name,
+			SourceVersion: v,
+		}
+		if len(fields) >= 5 {
+			if m := rpmSourceRpmRegexp.FindStringSubmatch(string(fields[4])); m != nil {
+				pkg.SourceName = m[1]
+			}
+		}
+		packages = append(packages, pkg)
+	}
+
+	return packages, nil
+}
+
+// GetRequiredFiles returns the list of files required for Detect, without
+// leading /
+func (detector *RpmPackagesDetector) GetRequiredFiles() []string {
+	return []string{rpmDbPath}
+}